@@ -1,8 +1,9 @@
 package cache
 
 import (
+	"context"
 	"log"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/pebble"
@@ -16,35 +17,88 @@ import (
 
 // resources
 
+// Statistics counters are sync/atomic so they can be bumped from any shard
+// without a lock, even while a caller only holds a shard's RLock.
 type Statistics struct {
-	cache_hits     int
-	cache_misses   int
-	cache_accesses int
-	evictions      int
-	prefetches     int
-	additions      int
+	cache_hits          atomic.Int64
+	cache_misses        atomic.Int64
+	cache_accesses      atomic.Int64
+	evictions           atomic.Int64
+	prefetches          atomic.Int64
+	additions           atomic.Int64
+	promotions          atomic.Int64
+	demotions           atomic.Int64
+	write_back_failures atomic.Int64
+
+	secondary_hits      atomic.Int64
+	secondary_misses    atomic.Int64
+	secondary_evictions atomic.Int64
 }
 
 func (s *Statistics) CacheHit() {
-	s.cache_accesses++
-	s.cache_hits++
+	s.cache_accesses.Add(1)
+	s.cache_hits.Add(1)
 }
 
 func (s *Statistics) CacheMiss() {
-	s.cache_accesses++
-	s.cache_misses++
+	s.cache_accesses.Add(1)
+	s.cache_misses.Add(1)
 }
 
 func (s *Statistics) CacheEvict() {
-	s.evictions++
+	s.evictions.Add(1)
 }
 
 func (s *Statistics) CachePrefetch() {
-	s.prefetches++
+	s.prefetches.Add(1)
 }
 
 func (s *Statistics) CacheAdd() {
-	s.additions++
+	s.additions.Add(1)
+}
+
+func (s *Statistics) CachePromote() {
+	s.promotions.Add(1)
+}
+
+func (s *Statistics) CacheDemote() {
+	s.demotions.Add(1)
+}
+
+// CacheWriteBackFailure records an async write-back (Evict or Set's
+// overflow path) that failed to land in pebble/secondary. The entry stays
+// in the shard's pending map rather than being dropped, so it's still
+// queryable via Get; this counter is how a caller notices it happened.
+func (s *Statistics) CacheWriteBackFailure() {
+	s.write_back_failures.Add(1)
+}
+
+func (s *Statistics) CacheSecondaryHit() {
+	s.secondary_hits.Add(1)
+}
+
+func (s *Statistics) CacheSecondaryMiss() {
+	s.secondary_misses.Add(1)
+}
+
+func (s *Statistics) CacheSecondaryEvict() {
+	s.secondary_evictions.Add(1)
+}
+
+// Add folds other's counters into s. Used when aggregating shard statistics.
+func (s *Statistics) Add(other *Statistics) {
+	s.cache_hits.Add(other.cache_hits.Load())
+	s.cache_misses.Add(other.cache_misses.Load())
+	s.cache_accesses.Add(other.cache_accesses.Load())
+	s.evictions.Add(other.evictions.Load())
+	s.prefetches.Add(other.prefetches.Load())
+	s.additions.Add(other.additions.Load())
+	s.promotions.Add(other.promotions.Load())
+	s.demotions.Add(other.demotions.Load())
+	s.write_back_failures.Add(other.write_back_failures.Load())
+	s.secondary_hits.Add(other.secondary_hits.Load())
+	s.secondary_misses.Add(other.secondary_misses.Load())
+	s.secondary_evictions.Add(other.secondary_evictions.Load())
 }
 
 type CacheEntry struct {
@@ -54,13 +108,62 @@ type CacheEntry struct {
 	last_updated   time.Time
 }
 
+// Cache is a striped, write-back cache in front of Pebble: the keyspace is
+// split across shards (each with its own lock, resident map, and
+// ReplacementPolicy) so unrelated keys never contend on the same mutex.
 type Cache struct {
-	MutexLock sync.RWMutex           // in case we do multithreaded workflows
-	data      map[string]*CacheEntry // key has to be a string because slices are mutable
-	capacity  int
+	shards   []*cacheShard
+	capacity int
+	db       *pebble.DB
+
+	policyFactory ReplacementPolicyFactory
+
+	numWriters      int
+	writeQueueDepth int
+	writeDurability *pebble.WriteOptions
+	writeback       *writeBackPool
+
+	secondary *SecondaryCache
 
-	stats *Statistics
-	db    *pebble.DB
+	prefetchWorkers int
+	metrics         *cacheMetrics
+}
+
+// ReplacementPolicyFactory builds a fresh ReplacementPolicy for one shard.
+// Each shard gets its own instance since hot/cold/ghost state is local to
+// the keys that hash into that shard.
+type ReplacementPolicyFactory func(capacity int, stats *Statistics) ReplacementPolicy
+
+// CacheOption configures optional behavior on CreateCache/CreateCacheSharded,
+// e.g. which ReplacementPolicy to use.
+type CacheOption func(*Cache)
+
+// WithReplacementPolicy overrides the default CLOCK-Pro policy. factory is
+// invoked once per shard so hot/cold/ghost state doesn't leak across shards.
+func WithReplacementPolicy(factory ReplacementPolicyFactory) CacheOption {
+	return func(c *Cache) {
+		c.policyFactory = factory
+	}
+}
+
+// WithWriteBack configures the async write-back pool that drains evicted
+// entries into pebble: numWriters workers pulling from a queue buffered to
+// queueDepth, writing with the given durability (pebble.Sync or
+// pebble.NoSync). durability may be nil to keep the default (pebble.Sync).
+func WithWriteBack(numWriters, queueDepth int, durability *pebble.WriteOptions) CacheOption {
+	return func(c *Cache) {
+		c.numWriters = numWriters
+		c.writeQueueDepth = queueDepth
+		c.writeDurability = durability
+	}
+}
+
+// WithPrefetchWorkers sets how many subfetcher goroutines PrefetchAsync
+// dispatches keys to. Defaults to 8.
+func WithPrefetchWorkers(n int) CacheOption {
+	return func(c *Cache) {
+		c.prefetchWorkers = n
+	}
 }
 
 func makeKey(k []byte) string {
@@ -69,227 +172,143 @@ func makeKey(k []byte) string {
 }
 
 func CreateStatistics() *Statistics {
-	return &Statistics{
-		cache_hits:     0,
-		cache_misses:   0,
-		cache_accesses: 0,
-		evictions:      0,
-		prefetches:     0,
-	}
+	return &Statistics{}
 }
 
-func CreateCache(db *pebble.DB, cache_capacity int) *Cache {
-	// In Go, local variables escape to the heap automatically if their
-	// address (or a pointer to them) is returned or stored somewhere.
-	statistics := CreateStatistics()
+// CreateCache builds an unsharded Cache (equivalent to CreateCacheSharded
+// with numShards=1), preserving the original single-mutex-shaped API for
+// callers that don't care about striping.
+func CreateCache(db *pebble.DB, cache_capacity int, opts ...CacheOption) *Cache {
+	return CreateCacheSharded(db, cache_capacity, 1, opts...)
+}
 
-	return &Cache{
-		data:     make(map[string]*CacheEntry),
+// CreateCacheSharded builds a Cache striped across numShards shards (rounded
+// up to the next power of two so shard selection can use a mask instead of
+// a modulo). capacity is divided evenly across shards.
+func CreateCacheSharded(db *pebble.DB, cache_capacity int, numShards int, opts ...CacheOption) *Cache {
+	c := &Cache{
 		capacity: cache_capacity,
 		db:       db,
-		stats:    statistics,
+		// Set before the options run so that WithWriteBack's queueDepth of 0
+		// keeps the queue unbuffered instead of being replaced by this default.
+		writeQueueDepth: 64,
 	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.policyFactory == nil {
+		// CLOCK-Pro is the default: it keeps hot keys resident and gives
+		// recently-evicted keys a second chance via non-resident tracking.
+		c.policyFactory = func(capacity int, stats *Statistics) ReplacementPolicy {
+			return NewClockProPolicy(capacity, stats)
+		}
+	}
+
+	if c.numWriters == 0 {
+		c.numWriters = 1
+	}
+	if c.prefetchWorkers == 0 {
+		c.prefetchWorkers = 8
+	}
+	c.metrics = newCacheMetrics()
+	c.writeback = newWriteBackPool(db, c.numWriters, c.writeQueueDepth, c.writeDurability)
+	c.writeback.secondary = c.secondary
+
+	n := nextPowerOfTwo(numShards)
+	// Distribute capacity as evenly as possible: a plain integer divide
+	// truncates any remainder (and can even round every shard down to 0,
+	// silently disabling caching entirely), so hand the first
+	// cache_capacity%n shards one extra slot instead of dropping it.
+	base := cache_capacity / n
+	remainder := cache_capacity % n
+	c.shards = make([]*cacheShard, n)
+	for i := range c.shards {
+		shardCapacity := base
+		if i < remainder {
+			shardCapacity++
+		}
+		c.shards[i] = newCacheShard(db, shardCapacity, c.policyFactory, c.writeback, c.secondary)
+	}
+
+	return c
 }
 
-func CreateCacheAndPebble(cache_capacity int) *Cache {
+func CreateCacheAndPebble(cache_capacity int, opts ...CacheOption) *Cache {
 	// creates the cache without a pebble instance (starts one itself)
 	db, err := pebble.Open("demo", &pebble.Options{})
 	if err != nil {
 		log.Println(err)
 		return nil
 	}
-	return CreateCache(db, cache_capacity)
+	return CreateCache(db, cache_capacity, opts...)
 }
 
 func (c *Cache) Close() error {
+	// Drain any outstanding write-back tasks before closing pebble out from
+	// under the workers.
+	_ = c.writeback.Flush(context.Background())
 	return c.db.Close()
 }
 
-func (c *Cache) Get(key []byte) ([]byte, bool, error) {
-	k := makeKey(key)
-
-	c.MutexLock.RLock()
-
-	if e, ok := c.data[k]; ok {
-		// if this is a hit on the cache
-		copied_val := append([]byte(nil), e.value...)
-		c.stats.CacheHit()
-		c.MutexLock.RUnlock()
-		return copied_val, true, nil
-	}
-
-	c.MutexLock.RUnlock()
-	c.stats.CacheMiss()
-
-	// gather the data from the database
-	value, closer, err := c.db.Get(key)
-	if err == pebble.ErrNotFound {
-		// not int the DB
-		return nil, false, nil
-	}
-	if err != nil {
-		return nil, false, err
-	}
-	copied_val := append([]byte(nil), value...)
-
-	// the closer is to avoid extra allocations, so after we copy the data,
-	// tell the closer to stop buffering the internal memory
-	if closer != nil {
-		_ = closer.Close()
+// shardFor returns the shard that owns k, selected by a fast hash of the raw
+// key bytes masked against the (power-of-two) shard count.
+func (c *Cache) shardFor(key []byte) *cacheShard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
 	}
+	h := fnv1a(key)
+	return c.shards[h&uint64(len(c.shards)-1)]
+}
 
-	return copied_val, true, nil
+func (c *Cache) Get(key []byte) ([]byte, bool, error) {
+	start := time.Now()
+	value, ok, err := c.shardFor(key).get(key)
+	c.metrics.getLatency.observe(time.Since(start))
+	return value, ok, err
 }
 
 func (c *Cache) Set(key, value []byte, addToCache bool) (bool, error) {
-	// returns bool: true if it was placed in the cache, false if it was placed into the db instead, error
-	k := makeKey(key)
-	v := append([]byte(nil), value...)
-
-	c.MutexLock.Lock()
-	defer c.MutexLock.Unlock()
-
-	if e, ok := c.data[k]; ok {
-		// if the data is already in the cache, update it there
-		c.stats.CacheHit()
-		e.last_updated = time.Now()
-		e.size = len(v)
-		e.value = v
-		return true, nil
-	} else {
-		c.stats.CacheMiss()
-		if addToCache && len(c.data) < c.capacity {
-			// if there is enough capacity and the addToCache bool is set, add it into the cache
-			en := &CacheEntry{
-				value:          value,
-				size:           len(v),
-				first_inserted: time.Now(),
-				last_updated:   time.Now(),
-			}
-			c.data[k] = en
-			return true, nil
-		} else {
-			// otherwise write to pebble
-			if err := c.db.Set(key, value, pebble.Sync); err != nil {
-				return false, err
-			}
-			return false, nil
-		}
-	}
-
+	start := time.Now()
+	placed, err := c.shardFor(key).set(key, value, addToCache)
+	c.metrics.setLatency.observe(time.Since(start))
+	return placed, err
 }
 
 func (c *Cache) Evict(key []byte) (bool, error) {
-	// The key parameter gets evicted from the cache, and written into pebble
-
-	// returns bool of if successfully evicted, error
-	k := makeKey(key)
-
-	c.MutexLock.Lock()
-
-	e, ok := c.data[k]
-	if !ok {
-		// this was never in the cache
-		c.MutexLock.Unlock()
-		return false, nil
-	}
-
-	// remove from cache and write it into pebble
-	delete(c.data, k)
-	c.MutexLock.Unlock()
-
-	// write to pebble (incur latency cost)
-	copied_val := append([]byte(nil), e.value...)
-	if err := c.db.Set([]byte(k), copied_val, pebble.Sync); err != nil {
-		return false, err
-	}
-
-	c.stats.CacheEvict()
-
-	return true, nil
+	return c.shardFor(key).evict(key)
 }
 
 func (c *Cache) RemainingCapacity() int {
 	// good idea to call this before prefetching to see what to evict and how many things we can prefetch
-	return c.capacity - len(c.data)
+	remaining := 0
+	for _, s := range c.shards {
+		remaining += s.remainingCapacity()
+	}
+	return remaining
 }
 
-func (c *Cache) Prefetch(keys [][]byte) (int, error) {
-	// prefetches keys and returns how many were succesfully prefetched and added to the cache
-
-	successes := 0
-
-	seen := make(map[string]struct{}, len(keys))
-	stringKeys := make([]string, 0, len(keys))
-	for _, kb := range keys {
-		k := makeKey(kb)
-		if _, ok := seen[k]; ok {
-			continue
-		}
-		seen[k] = struct{}{}
-		stringKeys = append(stringKeys, k)
+// Statistics aggregates every shard's counters into a single snapshot. The
+// returned Statistics is a standalone value, not shared with any shard.
+func (c *Cache) Statistics() *Statistics {
+	total := CreateStatistics()
+	for _, s := range c.shards {
+		total.Add(s.stats)
 	}
-
-	for _, k := range stringKeys {
-		// Already present?
-		c.MutexLock.RLock()
-		if _, ok := c.data[k]; ok {
-			c.MutexLock.RUnlock()
-			successes++ // already cached counts as success
-			continue
-		}
-		c.MutexLock.RUnlock()
-
-		// Miss → read from Pebble (no locks held during I/O)
-		val, closer, err := c.db.Get([]byte(k))
-		if err == pebble.ErrNotFound {
-			if closer != nil {
-				_ = closer.Close()
-			}
-			continue // not a success; key doesn't exist
-		}
-		if err != nil {
-			if closer != nil {
-				_ = closer.Close()
-			}
-			// Return the first real error; partial prefetches may have succeeded.
-			return successes, err
-		}
-
-		// Copy before closing the closer so we own the bytes.
-		copied_val := append([]byte(nil), val...)
-		if closer != nil {
-			_ = closer.Close()
-		}
-
-		// Insert only if there is room (do not evict).
-		c.MutexLock.Lock()
-		if _, ok := c.data[k]; ok {
-			// Raced with another inserter: treat as success.
-			c.MutexLock.Unlock()
-			successes++
-			continue
-		}
-
-		if c.RemainingCapacity() == 0 {
-			// No space → skip (non-evicting prefetch)
-			c.MutexLock.Unlock()
-			continue
-		}
-
-		// Add to cache.
-
-		en := &CacheEntry{
-			value:          copied_val,
-			size:           len(copied_val),
-			first_inserted: time.Now(),
-			last_updated:   time.Now(),
-		}
-
-		c.data[k] = en
-		c.MutexLock.Unlock()
-		successes++
+	if c.secondary != nil {
+		total.Add(c.secondary.stats)
 	}
+	return total
+}
 
-	return successes, nil
+// Prefetch loads keys into the cache, returning how many keys were found
+// (already cached, or read from the secondary tier or pebble). A key that is
+// read but not admitted because its shard has no room still counts. It's a thin wrapper
+// around PrefetchAsync for callers that just want to block until it's done.
+func (c *Cache) Prefetch(keys [][]byte) (int, error) {
+	start := time.Now()
+	n, err := c.PrefetchAsync(keys).Wait()
+	c.metrics.prefetchLatency.observe(time.Since(start))
+	return n, err
 }
@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// latencyBuckets mirrors sharedcache's histogram buckets: exponential from
+// 1µs up past 10s.
+var latencyBuckets = prometheus.ExponentialBuckets(0.000001, 2, 25)
+
+// histogram is a minimal, lock-free latency histogram keyed to
+// latencyBuckets. It exists so Get/Set/Evict/Prefetch can record latency on
+// the hot path with nothing heavier than atomic adds; RegisterPrometheus
+// turns a snapshot of it into a real prometheus histogram at scrape time.
+type histogram struct {
+	bucketCounts []atomic.Int64 // per-bucket (not cumulative) counts up to latencyBuckets[i]; last slot is overflow
+	sum          atomic.Int64   // nanoseconds
+	count        atomic.Int64
+}
+
+func newHistogram() *histogram {
+	return &histogram{bucketCounts: make([]atomic.Int64, len(latencyBuckets)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.sum.Add(int64(d))
+	h.count.Add(1)
+
+	seconds := d.Seconds()
+	idx := len(latencyBuckets) // overflow bucket: slower than the last boundary
+	for i, b := range latencyBuckets {
+		if seconds <= b {
+			idx = i
+			break
+		}
+	}
+	h.bucketCounts[idx].Add(1)
+}
+
+func (h *histogram) mean() time.Duration {
+	n := h.count.Load()
+	if n == 0 {
+		return 0
+	}
+	return time.Duration(h.sum.Load() / n)
+}
+
+// snapshot returns prometheus-shaped cumulative bucket counts (each bucket
+// includes every observation at or below its boundary), plus sum/count.
+func (h *histogram) snapshot() (buckets map[float64]uint64, sum float64, count uint64) {
+	buckets = make(map[float64]uint64, len(latencyBuckets))
+	var running uint64
+	for i, b := range latencyBuckets {
+		running += uint64(h.bucketCounts[i].Load())
+		buckets[b] = running
+	}
+	count = uint64(h.count.Load())
+	sum = float64(h.sum.Load()) / float64(time.Second)
+	return buckets, sum, count
+}
+
+// cacheMetrics holds the hot-path latency histograms for one Cache.
+type cacheMetrics struct {
+	getLatency      *histogram
+	setLatency      *histogram
+	prefetchLatency *histogram
+}
+
+func newCacheMetrics() *cacheMetrics {
+	return &cacheMetrics{
+		getLatency:      newHistogram(),
+		setLatency:      newHistogram(),
+		prefetchLatency: newHistogram(),
+	}
+}
+
+// Metrics is a point-in-time, exported snapshot of a Cache's counters,
+// gauges, and mean latencies -- for callers that don't run Prometheus but
+// still want to read Statistics out programmatically.
+type Metrics struct {
+	Hits       int64
+	Misses     int64
+	Accesses   int64
+	Evictions  int64
+	Prefetches int64
+	Additions  int64
+	Promotions int64
+	Demotions  int64
+
+	WriteBackFailures int64
+
+	SecondaryHits      int64
+	SecondaryMisses    int64
+	SecondaryEvictions int64
+
+	Resident            int
+	RemainingCapacity   int
+	WriteBackQueueDepth int
+
+	GetLatency      time.Duration
+	SetLatency      time.Duration
+	EvictLatency    time.Duration
+	PrefetchLatency time.Duration
+}
+
+// Metrics takes a snapshot of every counter, gauge, and mean latency this
+// Cache tracks.
+func (c *Cache) Metrics() Metrics {
+	stats := c.Statistics()
+
+	resident := 0
+	for _, s := range c.shards {
+		s.MutexLock.RLock()
+		resident += len(s.data)
+		s.MutexLock.RUnlock()
+	}
+
+	return Metrics{
+		Hits:       stats.cache_hits.Load(),
+		Misses:     stats.cache_misses.Load(),
+		Accesses:   stats.cache_accesses.Load(),
+		Evictions:  stats.evictions.Load(),
+		Prefetches: stats.prefetches.Load(),
+		Additions:  stats.additions.Load(),
+		Promotions: stats.promotions.Load(),
+		Demotions:  stats.demotions.Load(),
+
+		WriteBackFailures: stats.write_back_failures.Load(),
+
+		SecondaryHits:      stats.secondary_hits.Load(),
+		SecondaryMisses:    stats.secondary_misses.Load(),
+		SecondaryEvictions: stats.secondary_evictions.Load(),
+
+		Resident:            resident,
+		RemainingCapacity:   c.RemainingCapacity(),
+		WriteBackQueueDepth: c.writeback.QueueDepth(),
+
+		GetLatency:      c.metrics.getLatency.mean(),
+		SetLatency:      c.metrics.setLatency.mean(),
+		EvictLatency:    c.writeback.latency.mean(),
+		PrefetchLatency: c.metrics.prefetchLatency.mean(),
+	}
+}
+
+// MetricsHandler logs a one-line Metrics summary on every tick, for
+// deployments that don't scrape Prometheus. It returns a stop function that
+// halts the background goroutine.
+func (c *Cache) MetricsHandler(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m := c.Metrics()
+				log.Printf(
+					"cache: hits=%d misses=%d resident=%d remaining=%d get=%s set=%s evict=%s prefetch=%s writeback_queue=%d",
+					m.Hits, m.Misses, m.Resident, m.RemainingCapacity,
+					m.GetLatency, m.SetLatency, m.EvictLatency, m.PrefetchLatency,
+					m.WriteBackQueueDepth,
+				)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+type cacheCollector struct {
+	c *Cache
+
+	hitsDesc       *prometheus.Desc
+	missesDesc     *prometheus.Desc
+	accessesDesc   *prometheus.Desc
+	evictionsDesc  *prometheus.Desc
+	prefetchesDesc *prometheus.Desc
+	additionsDesc  *prometheus.Desc
+
+	residentDesc  *prometheus.Desc
+	remainingDesc *prometheus.Desc
+
+	getLatencyDesc      *prometheus.Desc
+	setLatencyDesc      *prometheus.Desc
+	evictLatencyDesc    *prometheus.Desc
+	prefetchLatencyDesc *prometheus.Desc
+}
+
+func newCacheCollector(c *Cache, namespace string) *cacheCollector {
+	counter := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(fmt.Sprintf("%s_%s", namespace, name), help, nil, nil)
+	}
+	return &cacheCollector{
+		c: c,
+
+		hitsDesc:       counter("cache_hits_total", "Total cache hits."),
+		missesDesc:     counter("cache_misses_total", "Total cache misses."),
+		accessesDesc:   counter("cache_accesses_total", "Total cache accesses (hits + misses)."),
+		evictionsDesc:  counter("cache_evictions_total", "Total entries evicted from the cache."),
+		prefetchesDesc: counter("cache_prefetches_total", "Total entries added via Prefetch/PrefetchAsync."),
+		additionsDesc:  counter("cache_additions_total", "Total entries admitted via Set."),
+
+		residentDesc:  counter("cache_resident_entries", "Number of entries currently resident in memory."),
+		remainingDesc: counter("cache_remaining_capacity", "Remaining in-memory capacity across all shards."),
+
+		getLatencyDesc:      counter("cache_get_latency_seconds", "Get latency."),
+		setLatencyDesc:      counter("cache_set_latency_seconds", "Set latency."),
+		evictLatencyDesc:    counter("cache_evict_to_pebble_latency_seconds", "Latency of a write-back worker's Evict flush into pebble."),
+		prefetchLatencyDesc: counter("cache_prefetch_batch_latency_seconds", "Latency of a whole Prefetch/PrefetchAsync batch."),
+	}
+}
+
+func (cc *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.hitsDesc
+	ch <- cc.missesDesc
+	ch <- cc.accessesDesc
+	ch <- cc.evictionsDesc
+	ch <- cc.prefetchesDesc
+	ch <- cc.additionsDesc
+	ch <- cc.residentDesc
+	ch <- cc.remainingDesc
+	ch <- cc.getLatencyDesc
+	ch <- cc.setLatencyDesc
+	ch <- cc.evictLatencyDesc
+	ch <- cc.prefetchLatencyDesc
+}
+
+func (cc *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	m := cc.c.Metrics()
+
+	ch <- prometheus.MustNewConstMetric(cc.hitsDesc, prometheus.CounterValue, float64(m.Hits))
+	ch <- prometheus.MustNewConstMetric(cc.missesDesc, prometheus.CounterValue, float64(m.Misses))
+	ch <- prometheus.MustNewConstMetric(cc.accessesDesc, prometheus.CounterValue, float64(m.Accesses))
+	ch <- prometheus.MustNewConstMetric(cc.evictionsDesc, prometheus.CounterValue, float64(m.Evictions))
+	ch <- prometheus.MustNewConstMetric(cc.prefetchesDesc, prometheus.CounterValue, float64(m.Prefetches))
+	ch <- prometheus.MustNewConstMetric(cc.additionsDesc, prometheus.CounterValue, float64(m.Additions))
+
+	ch <- prometheus.MustNewConstMetric(cc.residentDesc, prometheus.GaugeValue, float64(m.Resident))
+	ch <- prometheus.MustNewConstMetric(cc.remainingDesc, prometheus.GaugeValue, float64(m.RemainingCapacity))
+
+	cc.emitHistogram(ch, cc.getLatencyDesc, cc.c.metrics.getLatency)
+	cc.emitHistogram(ch, cc.setLatencyDesc, cc.c.metrics.setLatency)
+	cc.emitHistogram(ch, cc.evictLatencyDesc, cc.c.writeback.latency)
+	cc.emitHistogram(ch, cc.prefetchLatencyDesc, cc.c.metrics.prefetchLatency)
+}
+
+func (cc *cacheCollector) emitHistogram(ch chan<- prometheus.Metric, desc *prometheus.Desc, h *histogram) {
+	buckets, sum, count := h.snapshot()
+	ch <- prometheus.MustNewConstHistogram(desc, count, sum, buckets)
+}
+
+// RegisterPrometheus publishes this Cache's counters, gauges, and latency
+// histograms (Get/Set/Evict-to-pebble/Prefetch-batch) under namespace.
+func (c *Cache) RegisterPrometheus(reg prometheus.Registerer, namespace string) error {
+	return reg.Register(newCacheCollector(c, namespace))
+}
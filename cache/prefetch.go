@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// inflightFetch is a pending Pebble read for one key, registered under the
+// owning shard's lock so a concurrent Get for the same key can wait on it
+// instead of issuing a redundant db.Get (single-flight).
+type inflightFetch struct {
+	done  chan struct{}
+	value []byte
+	found bool
+	err   error
+}
+
+// fetchOne is the unit of work a PrefetchAsync subfetcher performs: check
+// residency, single-flight against any other fetch of the same key, read
+// from Pebble (or the secondary tier) if neither hit, and admit on success.
+func (c *cacheShard) fetchOne(key []byte) (bool, error) {
+	k := makeKey(key)
+
+	c.MutexLock.Lock()
+	if _, ok := c.data[k]; ok {
+		c.MutexLock.Unlock()
+		return true, nil
+	}
+	if c.inflight == nil {
+		c.inflight = make(map[string]*inflightFetch)
+	}
+	if existing, ok := c.inflight[k]; ok {
+		c.MutexLock.Unlock()
+		<-existing.done
+		return existing.found, existing.err
+	}
+	f := &inflightFetch{done: make(chan struct{})}
+	c.inflight[k] = f
+	c.MutexLock.Unlock()
+
+	found, value, err := c.readThrough(key)
+	f.found, f.value, f.err = found, value, err
+	close(f.done)
+
+	c.MutexLock.Lock()
+	delete(c.inflight, k)
+	if err == nil && found {
+		if _, ok := c.data[k]; !ok {
+			c.admitPrefetched(key, k, value)
+		}
+	}
+	c.MutexLock.Unlock()
+
+	return found, err
+}
+
+// readThrough fetches key from the secondary tier (if any) and then Pebble,
+// without touching any locks. Called with no shard lock held.
+func (c *cacheShard) readThrough(key []byte) (found bool, value []byte, err error) {
+	if c.secondary != nil {
+		if v, ok, err := c.secondary.Get(key); err != nil {
+			return false, nil, err
+		} else if ok {
+			return true, v, nil
+		}
+	}
+
+	val, closer, err := c.db.Get(key)
+	if err == pebble.ErrNotFound {
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return false, nil, nil
+	}
+	if err != nil {
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return false, nil, err
+	}
+	copied_val := append([]byte(nil), val...)
+	if closer != nil {
+		_ = closer.Close()
+	}
+	return true, copied_val, nil
+}
+
+// admitPrefetched admits value into the shard (or, with no memory capacity
+// at all, the secondary tier) once a fetch has confirmed it exists. Called
+// with c.MutexLock already held.
+func (c *cacheShard) admitPrefetched(key []byte, k string, value []byte) {
+	if c.capacity == 0 && c.secondary != nil {
+		// No in-memory capacity: populate the secondary tier directly
+		// instead of dropping the prefetch on the floor.
+		if err := c.secondary.Put(key, value); err == nil {
+			c.stats.CachePrefetch()
+		}
+		return
+	}
+
+	if c.capacity-len(c.data) == 0 {
+		// No space → skip (non-evicting prefetch)
+		return
+	}
+
+	c.policy.Insert(k)
+	en := &CacheEntry{
+		value:          value,
+		size:           len(value),
+		first_inserted: time.Now(),
+		last_updated:   time.Now(),
+	}
+	c.data[k] = en
+	c.stats.CachePrefetch()
+}
+
+// PrefetchHandle tracks an in-flight PrefetchAsync call.
+type PrefetchHandle struct {
+	successes atomic.Int64
+	wg        sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+
+	cancelCh   chan struct{}
+	cancelOnce sync.Once
+}
+
+func (h *PrefetchHandle) setErr(err error) {
+	h.errOnce.Do(func() { h.err = err })
+}
+
+// Wait blocks until every subfetcher has finished (or been cancelled),
+// returning the number of keys found (including ones not admitted for lack
+// of room) and the first error encountered, if any.
+func (h *PrefetchHandle) Wait() (int, error) {
+	h.wg.Wait()
+	return int(h.successes.Load()), h.err
+}
+
+// Cancel stops dispatching new work; subfetchers already reading from
+// Pebble finish that single read and then drain.
+func (h *PrefetchHandle) Cancel() {
+	h.cancelOnce.Do(func() { close(h.cancelCh) })
+}
+
+// PrefetchAsync loads keys into the cache using a bounded pool of subfetcher
+// goroutines so many Pebble reads can overlap, instead of the one-at-a-time
+// loop a synchronous Prefetch would do. Duplicate keys are deduped up
+// front; concurrent Get calls for a key already being prefetched are
+// single-flighted via each shard's inflight map.
+func (c *Cache) PrefetchAsync(keys [][]byte) *PrefetchHandle {
+	h := &PrefetchHandle{cancelCh: make(chan struct{})}
+
+	seen := make(map[string]struct{}, len(keys))
+	dedup := make([][]byte, 0, len(keys))
+	for _, kb := range keys {
+		k := makeKey(kb)
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		dedup = append(dedup, kb)
+	}
+
+	numWorkers := c.prefetchWorkers
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if numWorkers > len(dedup) {
+		numWorkers = len(dedup)
+	}
+	if numWorkers == 0 {
+		return h
+	}
+
+	work := make(chan []byte)
+
+	h.wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer h.wg.Done()
+			for kb := range work {
+				found, err := c.shardFor(kb).fetchOne(kb)
+				if err != nil {
+					h.setErr(err)
+					continue
+				}
+				if found {
+					h.successes.Add(1)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(work)
+		for _, kb := range dedup {
+			select {
+			case work <- kb:
+			case <-h.cancelCh:
+				return
+			}
+		}
+	}()
+
+	return h
+}
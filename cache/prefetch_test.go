@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+func setupPrefetchBenchDB(b *testing.B, fanout int) (*pebble.DB, [][]byte) {
+	b.Helper()
+	db, err := pebble.Open("", &pebble.Options{FS: vfs.NewMem()})
+	if err != nil {
+		b.Fatalf("pebble.Open: %v", err)
+	}
+	b.Cleanup(func() { db.Close() })
+
+	keys := make([][]byte, fanout)
+	for i := 0; i < fanout; i++ {
+		k := []byte(fmt.Sprintf("key-%d", i))
+		if err := db.Set(k, []byte(fmt.Sprintf("value-%d", i)), pebble.Sync); err != nil {
+			b.Fatalf("db.Set: %v", err)
+		}
+		keys[i] = k
+	}
+	return db, keys
+}
+
+func benchmarkSerialPrefetch(b *testing.B, fanout, capacity int) {
+	db, keys := setupPrefetchBenchDB(b, fanout)
+	c := CreateCache(db, capacity)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			if _, err := c.shardFor(k).fetchOne(k); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func benchmarkParallelPrefetch(b *testing.B, fanout, capacity int) {
+	db, keys := setupPrefetchBenchDB(b, fanout)
+	c := CreateCache(db, capacity, WithPrefetchWorkers(fanout))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.PrefetchAsync(keys).Wait(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkPrefetch compares serial (one subfetcher at a time) against
+// PrefetchAsync's parallel subfetcher pool, at a range of fanouts and under
+// both ample and scarce in-memory capacity, to see where overlapping Pebble
+// reads actually pays for the extra goroutine/channel overhead.
+func BenchmarkPrefetch(b *testing.B) {
+	fanouts := []int{1, 4, 16, 64}
+	capacityPressures := []struct {
+		name   string
+		factor float64 // fraction of fanout kept resident
+	}{
+		{"FullCapacity", 1.0},
+		{"QuarterCapacity", 0.25},
+	}
+
+	for _, fanout := range fanouts {
+		for _, cp := range capacityPressures {
+			capacity := int(float64(fanout) * cp.factor)
+			if capacity < 1 {
+				capacity = 1
+			}
+
+			b.Run(fmt.Sprintf("Serial/Fanout%d/%s", fanout, cp.name), func(b *testing.B) {
+				benchmarkSerialPrefetch(b, fanout, capacity)
+			})
+			b.Run(fmt.Sprintf("Parallel/Fanout%d/%s", fanout, cp.name), func(b *testing.B) {
+				benchmarkParallelPrefetch(b, fanout, capacity)
+			})
+		}
+	}
+}
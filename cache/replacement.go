@@ -0,0 +1,352 @@
+package cache
+
+import "container/list"
+
+// ReplacementPolicy decides which resident key to evict when the cache is
+// full, and tracks whatever bookkeeping it needs (reference bits, recency
+// lists, ghost entries, ...) to make that decision. Cache delegates all of
+// its admission/eviction decisions to a ReplacementPolicy so that different
+// strategies can be swapped in via CreateCache's options.
+type ReplacementPolicy interface {
+	// Touch records a hit on a resident key, e.g. setting a reference bit
+	// or moving it to the front of a recency list.
+	Touch(key string)
+
+	// Insert admits key as a brand-new resident entry. It returns true if
+	// key was already being tracked as a non-resident (ghost) entry, in
+	// which case the caller should treat it as promoted rather than cold.
+	Insert(key string) (wasNonResident bool)
+
+	// Victim picks a resident key to evict to make room for a new one. It
+	// returns ok=false if the policy has nothing resident left to give up.
+	Victim() (key string, ok bool)
+
+	// Remove drops all bookkeeping for key, e.g. after an explicit Evict().
+	Remove(key string)
+}
+
+// pageState is the CLOCK-Pro state of a tracked key.
+type pageState int
+
+const (
+	stateHot pageState = iota
+	stateCold
+	stateNonResident
+)
+
+type clockEntry struct {
+	key   string
+	state pageState
+	ref   bool
+}
+
+// ClockProPolicy implements a simplified CLOCK-Pro: a single circular list
+// holding hot, cold-resident, and non-resident "test" entries, a reference
+// bit per entry, and three rotating hands (handHot, handCold, handTest).
+// coldCap is an adaptive size for the cold-resident region: it grows toward
+// capacity on hits to non-resident test entries and shrinks back on hits to
+// hot entries. Victim and the hands do not read coldCap; eviction always
+// sweeps cold pages first and falls back to handHot only when that finds
+// no victim.
+type ClockProPolicy struct {
+	capacity int
+	coldCap  int
+
+	order    *list.List
+	index    map[string]*list.Element
+	handCold *list.Element
+	handHot  *list.Element
+	handTest *list.Element
+
+	residentHot  int
+	residentCold int
+	nonResident  int
+
+	stats *Statistics
+}
+
+// NewClockProPolicy constructs a CLOCK-Pro policy sized for capacity resident
+// entries. stats may be nil; when set, promotions/demotions are recorded on
+// it. Evictions are not: the caller counts those.
+func NewClockProPolicy(capacity int, stats *Statistics) *ClockProPolicy {
+	return &ClockProPolicy{
+		capacity: capacity,
+		coldCap:  1,
+		order:    list.New(),
+		index:    make(map[string]*list.Element),
+		stats:    stats,
+	}
+}
+
+// advance moves hand to the next element in the circular list, wrapping
+// around to the front. It returns nil only when the list is empty.
+func (p *ClockProPolicy) advance(hand *list.Element) *list.Element {
+	if hand == nil {
+		return nil
+	}
+	if next := hand.Next(); next != nil {
+		return next
+	}
+	return p.order.Front()
+}
+
+func (p *ClockProPolicy) Touch(key string) {
+	e, ok := p.index[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*clockEntry)
+	entry.ref = true
+	if entry.state == stateHot && p.coldCap > 1 {
+		// A hit on an already-hot page means the cold region could afford to
+		// be smaller.
+		p.coldCap--
+	}
+}
+
+func (p *ClockProPolicy) Insert(key string) bool {
+	if existing, ok := p.index[key]; ok {
+		entry := existing.Value.(*clockEntry)
+		wasNonResident := entry.state == stateNonResident
+		if wasNonResident {
+			p.nonResident--
+			p.residentHot++
+			entry.state = stateHot
+			entry.ref = false
+			if p.coldCap < p.capacity-1 {
+				p.coldCap++
+			}
+			if p.stats != nil {
+				p.stats.CachePromote()
+			}
+		}
+		return wasNonResident
+	}
+
+	entry := &clockEntry{key: key, state: stateCold, ref: false}
+	p.residentCold++
+	if p.handCold == nil {
+		// First entry in the list; every hand starts here.
+		elem := p.order.PushBack(entry)
+		p.index[key] = elem
+		p.handCold = elem
+		p.handHot = elem
+		p.handTest = elem
+		return false
+	}
+	elem := p.order.InsertBefore(entry, p.handCold)
+	p.index[key] = elem
+	return false
+}
+
+func (p *ClockProPolicy) Victim() (string, bool) {
+	if p.residentCold > 0 {
+		if key, ok := p.runHandCold(); ok {
+			return key, true
+		}
+	}
+	return p.runHandHot()
+}
+
+// runHandCold sweeps handCold looking for a cold page to evict. Pages with
+// the reference bit set get a second chance and are promoted to hot; the
+// first page found with a clear reference bit is evicted (demoted to a
+// non-resident test entry) and returned as the victim.
+func (p *ClockProPolicy) runHandCold() (string, bool) {
+	start := p.handCold
+	for e := start; e != nil; {
+		entry := e.Value.(*clockEntry)
+		next := p.advance(e)
+
+		if entry.state != stateCold {
+			e = next
+			if e == start {
+				break
+			}
+			continue
+		}
+
+		if entry.ref {
+			entry.ref = false
+			entry.state = stateHot
+			p.residentCold--
+			p.residentHot++
+			if p.stats != nil {
+				p.stats.CachePromote()
+			}
+			e = next
+			p.handCold = e
+			if e == start {
+				break
+			}
+			continue
+		}
+
+		// Victim found: keep the key around as a non-resident test entry so
+		// a future Insert can detect the ghost hit and re-promote to hot.
+		// This is the eviction itself (the caller's CacheEvict() already
+		// counts it) -- not a demotion, so it doesn't touch p.stats here.
+		entry.state = stateNonResident
+		p.residentCold--
+		p.nonResident++
+		p.handCold = next
+		p.trimNonResident()
+		return entry.key, true
+	}
+	return "", false
+}
+
+// runHandHot sweeps handHot, clearing reference bits on hot pages and
+// demoting the first one found already clear to cold. It then runs handCold
+// in the same call, so the demoted page is returned as the victim. If every
+// hot page had its bit set, one full sweep only clears them and no victim
+// is returned.
+func (p *ClockProPolicy) runHandHot() (string, bool) {
+	if p.residentHot == 0 {
+		return "", false
+	}
+	start := p.handHot
+	for e := start; e != nil; {
+		entry := e.Value.(*clockEntry)
+		next := p.advance(e)
+
+		if entry.state != stateHot {
+			e = next
+			if e == start {
+				break
+			}
+			continue
+		}
+
+		if entry.ref {
+			entry.ref = false
+			e = next
+			p.handHot = e
+			if e == start {
+				break
+			}
+			continue
+		}
+
+		entry.state = stateCold
+		p.residentHot--
+		p.residentCold++
+		p.handHot = next
+		if p.stats != nil {
+			p.stats.CacheDemote()
+		}
+		// The page just demoted to cold is now a legitimate victim.
+		return p.runHandCold()
+	}
+	return "", false
+}
+
+// trimNonResident caps the number of tracked ghost (non-resident) entries at
+// capacity by dropping the oldest ones off handTest.
+func (p *ClockProPolicy) trimNonResident() {
+	for p.nonResident > p.capacity && p.handTest != nil {
+		entry := p.handTest.Value.(*clockEntry)
+		if entry.state != stateNonResident {
+			p.handTest = p.advance(p.handTest)
+			continue
+		}
+		victim := p.handTest
+		p.handTest = p.advance(p.handTest)
+		p.removeElem(victim)
+		p.nonResident--
+	}
+}
+
+func (p *ClockProPolicy) Remove(key string) {
+	e, ok := p.index[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*clockEntry)
+	switch entry.state {
+	case stateHot:
+		p.residentHot--
+	case stateCold:
+		p.residentCold--
+	case stateNonResident:
+		p.nonResident--
+	}
+	p.removeElem(e)
+}
+
+func (p *ClockProPolicy) removeElem(e *list.Element) {
+	entry := e.Value.(*clockEntry)
+	if p.handCold == e {
+		p.handCold = p.advance(e)
+		if p.handCold == e {
+			p.handCold = nil
+		}
+	}
+	if p.handHot == e {
+		p.handHot = p.advance(e)
+		if p.handHot == e {
+			p.handHot = nil
+		}
+	}
+	if p.handTest == e {
+		p.handTest = p.advance(e)
+		if p.handTest == e {
+			p.handTest = nil
+		}
+	}
+	delete(p.index, entry.key)
+	p.order.Remove(e)
+}
+
+// LRUPolicy is a fallback ReplacementPolicy: plain least-recently-used, no
+// ghost tracking. It's selectable via CreateCache for workloads where
+// CLOCK-Pro's extra bookkeeping isn't worth it.
+type LRUPolicy struct {
+	order *list.List
+	index map[string]*list.Element
+}
+
+type lruEntry struct {
+	key string
+}
+
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{
+		order: list.New(),
+		index: make(map[string]*list.Element),
+	}
+}
+
+func (p *LRUPolicy) Touch(key string) {
+	if e, ok := p.index[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *LRUPolicy) Insert(key string) bool {
+	if e, ok := p.index[key]; ok {
+		p.order.MoveToFront(e)
+		return false
+	}
+	p.index[key] = p.order.PushFront(&lruEntry{key: key})
+	return false
+}
+
+func (p *LRUPolicy) Victim() (string, bool) {
+	back := p.order.Back()
+	if back == nil {
+		return "", false
+	}
+	// Stop tracking the victim so the next call picks a different key.
+	key := back.Value.(*lruEntry).key
+	p.order.Remove(back)
+	delete(p.index, key)
+	return key, true
+}
+
+func (p *LRUPolicy) Remove(key string) {
+	if e, ok := p.index[key]; ok {
+		p.order.Remove(e)
+		delete(p.index, key)
+	}
+}
@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// SecondaryCache is a persistent, file-backed second tier sitting between
+// the in-memory Cache and pebble, inspired by pebble's own sharedcache
+// package: fixed-size blocks on disk, sharded so unrelated keys don't
+// contend, with a CLOCK sweep over resident blocks standing in for the
+// in-memory CLOCK-Pro policy. It does not replace pebble -- when the
+// secondary tier itself runs out of room it flushes the evicted entry to
+// pebble via db.
+//
+// Each block holds its full key (not just the hash) so an evicted block's
+// original key/value can still be written to pebble; the SHA-256 hash is
+// only used to pick a shard and to index blocks within it cheaply.
+type SecondaryCache struct {
+	shards []*secondaryShard
+	db     *pebble.DB
+	stats  *Statistics
+}
+
+// secondaryBlockHeader is the fixed-size prefix written at the start of
+// every block.
+//
+//	[0:32)  keyHash  (sha256 of the user key)
+//	[32:34) keyLen   (uint16, big-endian)
+//	[34:38) valueLen (uint32, big-endian)
+//	[38:)   key bytes followed by value bytes
+const secondaryHeaderSize = 32 + 2 + 4
+
+type secondaryShard struct {
+	mu        sync.Mutex
+	file      *os.File
+	blockSize int
+	numBlocks int
+
+	index map[[32]byte]int // keyHash -> block index
+	valid []bool
+	ref   []bool
+	hand  int
+}
+
+// CreateSecondaryCache opens (or creates) numShards block files under dir,
+// each pre-sized to hold blocksPerShard blocks of blockSize bytes, and
+// rebuilds its in-memory index by scanning whatever is already on disk.
+// It is safe to call against a pre-existing dir -- this is exactly what
+// RecoverSecondaryCache does.
+func CreateSecondaryCache(db *pebble.DB, dir string, numShards, blocksPerShard, blockSize int) (*SecondaryCache, error) {
+	if blockSize <= secondaryHeaderSize {
+		return nil, fmt.Errorf("cache: blockSize must be greater than %d", secondaryHeaderSize)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	sc := &SecondaryCache{
+		db:    db,
+		stats: CreateStatistics(),
+	}
+	for i := 0; i < numShards; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("shard-%d.bin", i))
+		shard, err := openSecondaryShard(path, blocksPerShard, blockSize)
+		if err != nil {
+			return nil, err
+		}
+		sc.shards = append(sc.shards, shard)
+	}
+	return sc, nil
+}
+
+// RecoverSecondaryCache rebuilds the in-memory index for an existing
+// on-disk secondary cache at dir by scanning the block metadata. It takes
+// the same shape/shard parameters the cache was originally created with.
+func RecoverSecondaryCache(db *pebble.DB, dir string, numShards, blocksPerShard, blockSize int) (*SecondaryCache, error) {
+	return CreateSecondaryCache(db, dir, numShards, blocksPerShard, blockSize)
+}
+
+func openSecondaryShard(path string, numBlocks, blockSize int) (*secondaryShard, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	size := int64(numBlocks) * int64(blockSize)
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	shard := &secondaryShard{
+		file:      file,
+		blockSize: blockSize,
+		numBlocks: numBlocks,
+		index:     make(map[[32]byte]int),
+		valid:     make([]bool, numBlocks),
+		ref:       make([]bool, numBlocks),
+	}
+	if err := shard.scan(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return shard, nil
+}
+
+// scan rebuilds index/valid from whatever headers are already on disk; a
+// block whose stored valueLen is zero is treated as empty.
+func (s *secondaryShard) scan() error {
+	buf := make([]byte, secondaryHeaderSize)
+	for blk := 0; blk < s.numBlocks; blk++ {
+		if _, err := s.file.ReadAt(buf, int64(blk)*int64(s.blockSize)); err != nil {
+			return err
+		}
+		valueLen := binary.BigEndian.Uint32(buf[34:38])
+		if valueLen == 0 {
+			continue
+		}
+		var hash [32]byte
+		copy(hash[:], buf[0:32])
+		s.index[hash] = blk
+		s.valid[blk] = true
+	}
+	return nil
+}
+
+func (s *secondaryShard) readBlock(blk int) (key, value []byte, err error) {
+	header := make([]byte, secondaryHeaderSize)
+	if _, err := s.file.ReadAt(header, int64(blk)*int64(s.blockSize)); err != nil {
+		return nil, nil, err
+	}
+	keyLen := binary.BigEndian.Uint16(header[32:34])
+	valueLen := binary.BigEndian.Uint32(header[34:38])
+
+	payload := make([]byte, int(keyLen)+int(valueLen))
+	if _, err := s.file.ReadAt(payload, int64(blk)*int64(s.blockSize)+secondaryHeaderSize); err != nil {
+		return nil, nil, err
+	}
+	return payload[:keyLen], payload[keyLen:], nil
+}
+
+func (s *secondaryShard) writeBlock(blk int, hash [32]byte, key, value []byte) error {
+	if secondaryHeaderSize+len(key)+len(value) > s.blockSize {
+		return fmt.Errorf("cache: entry (key %d + value %d bytes) too large for %d-byte secondary cache block", len(key), len(value), s.blockSize)
+	}
+
+	buf := make([]byte, secondaryHeaderSize+len(key)+len(value))
+	copy(buf[0:32], hash[:])
+	binary.BigEndian.PutUint16(buf[32:34], uint16(len(key)))
+	binary.BigEndian.PutUint32(buf[34:38], uint32(len(value)))
+	copy(buf[secondaryHeaderSize:], key)
+	copy(buf[secondaryHeaderSize+len(key):], value)
+
+	_, err := s.file.WriteAt(buf, int64(blk)*int64(s.blockSize))
+	return err
+}
+
+// evictedEntry is the key/value of a block the CLOCK sweep picked as a
+// victim, to be flushed to pebble by the caller.
+type evictedEntry struct {
+	key   []byte
+	value []byte
+}
+
+// allocate finds a free block, or runs the CLOCK sweep to make one: blocks
+// with the reference bit set get a second chance (cleared, skipped); the
+// first one found clear is evicted and returned as the victim.
+func (s *secondaryShard) allocate() (blk int, victim *evictedEntry, err error) {
+	for i, v := range s.valid {
+		if !v {
+			return i, nil, nil
+		}
+	}
+
+	for {
+		e := s.hand
+		s.hand = (s.hand + 1) % s.numBlocks
+		if s.ref[e] {
+			s.ref[e] = false
+			continue
+		}
+
+		key, value, err := s.readBlock(e)
+		if err != nil {
+			return 0, nil, err
+		}
+		for h, b := range s.index {
+			if b == e {
+				delete(s.index, h)
+				break
+			}
+		}
+		s.valid[e] = false
+		return e, &evictedEntry{key: key, value: value}, nil
+	}
+}
+
+func (s *secondaryShard) put(hash [32]byte, key, value []byte) (*evictedEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if blk, ok := s.index[hash]; ok {
+		s.ref[blk] = true
+		return nil, s.writeBlock(blk, hash, key, value)
+	}
+
+	blk, victim, err := s.allocate()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.writeBlock(blk, hash, key, value); err != nil {
+		return nil, err
+	}
+	s.index[hash] = blk
+	s.valid[blk] = true
+	s.ref[blk] = false
+	return victim, nil
+}
+
+func (s *secondaryShard) get(hash [32]byte) ([]byte, bool, error) {
+	// readBlock must happen under the same lock as the index lookup: if we
+	// released the lock first, a concurrent put() could run allocate()
+	// (which may pick blk as a victim) and writeBlock(blk, ...) for a
+	// completely different key before we read it back, handing the caller
+	// that other key's value with no error.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	blk, ok := s.index[hash]
+	if !ok {
+		return nil, false, nil
+	}
+	s.ref[blk] = true
+
+	_, value, err := s.readBlock(blk)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (sc *SecondaryCache) shardFor(hash [32]byte) *secondaryShard {
+	if len(sc.shards) == 1 {
+		return sc.shards[0]
+	}
+	idx := binary.BigEndian.Uint64(hash[:8]) % uint64(len(sc.shards))
+	return sc.shards[idx]
+}
+
+// Get checks the secondary tier for key, returning ok=false on a miss
+// (callers should then fall through to pebble).
+func (sc *SecondaryCache) Get(key []byte) ([]byte, bool, error) {
+	hash := sha256.Sum256(key)
+	value, ok, err := sc.shardFor(hash).get(hash)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		sc.stats.CacheSecondaryHit()
+	} else {
+		sc.stats.CacheSecondaryMiss()
+	}
+	return value, ok, nil
+}
+
+// Put admits key/value into the secondary tier, evicting a block via CLOCK
+// if the owning shard is full. An evicted entry is flushed to pebble before
+// Put returns.
+func (sc *SecondaryCache) Put(key, value []byte) error {
+	hash := sha256.Sum256(key)
+	victim, err := sc.shardFor(hash).put(hash, key, value)
+	if err != nil {
+		return err
+	}
+	if victim != nil {
+		sc.stats.CacheSecondaryEvict()
+		if sc.db != nil {
+			if err := sc.db.Set(victim.key, victim.value, pebble.Sync); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (sc *SecondaryCache) Close() error {
+	var firstErr error
+	for _, s := range sc.shards {
+		if err := s.file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// WithSecondaryCache wires a persistent on-disk tier between the in-memory
+// Cache and pebble: evictions land here before (and instead of) pebble, and
+// reads check here before falling through to pebble.
+func WithSecondaryCache(sc *SecondaryCache) CacheOption {
+	return func(c *Cache) {
+		c.secondary = sc
+	}
+}
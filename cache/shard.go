@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// fnv1a hashes raw key bytes for shard selection. FNV-1a is cheap and
+// spreads well enough for striping; it isn't used for anything
+// security-sensitive.
+func fnv1a(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// nextPowerOfTwo rounds n up so shard selection can mask instead of modulo.
+func nextPowerOfTwo(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// cacheShard owns one slice of the keyspace: its own lock, resident map,
+// capacity, and replacement policy. This is exactly the single-shard Cache
+// used to be, just parameterized so Cache can run many of them side by side.
+type cacheShard struct {
+	MutexLock sync.RWMutex
+	data      map[string]*CacheEntry
+	pending   map[string][]byte // evicted entries not yet landed in pebble
+	capacity  int
+	policy    ReplacementPolicy
+
+	stats     *Statistics
+	db        *pebble.DB
+	writeback *writeBackPool
+	secondary *SecondaryCache
+
+	inflight map[string]*inflightFetch
+}
+
+func newCacheShard(db *pebble.DB, capacity int, policyFactory ReplacementPolicyFactory, writeback *writeBackPool, secondary *SecondaryCache) *cacheShard {
+	stats := CreateStatistics()
+	return &cacheShard{
+		data:      make(map[string]*CacheEntry),
+		pending:   make(map[string][]byte),
+		capacity:  capacity,
+		db:        db,
+		stats:     stats,
+		policy:    policyFactory(capacity, stats),
+		writeback: writeback,
+		secondary: secondary,
+	}
+}
+
+// clearPending drops key's pending-flush entry once the write-back worker
+// has confirmed it landed in pebble.
+func (c *cacheShard) clearPending(key string) {
+	c.MutexLock.Lock()
+	delete(c.pending, key)
+	c.MutexLock.Unlock()
+}
+
+func (c *cacheShard) get(key []byte) ([]byte, bool, error) {
+	k := makeKey(key)
+
+	c.MutexLock.RLock()
+
+	if e, ok := c.data[k]; ok {
+		// if this is a hit on the cache
+		copied_val := append([]byte(nil), e.value...)
+		c.stats.CacheHit()
+		c.policy.Touch(k)
+		c.MutexLock.RUnlock()
+		return copied_val, true, nil
+	}
+
+	if v, ok := c.pending[k]; ok {
+		// evicted but not yet flushed by a write-back worker
+		copied_val := append([]byte(nil), v...)
+		c.stats.CacheHit()
+		c.MutexLock.RUnlock()
+		return copied_val, true, nil
+	}
+
+	// A PrefetchAsync subfetcher may already be reading this exact key;
+	// wait on it instead of issuing a redundant Pebble read.
+	inflight := c.inflight[k]
+
+	c.MutexLock.RUnlock()
+	c.stats.CacheMiss()
+
+	if inflight != nil {
+		<-inflight.done
+		return append([]byte(nil), inflight.value...), inflight.found, inflight.err
+	}
+
+	found, value, err := c.readThrough(key)
+	return value, found, err
+}
+
+func (c *cacheShard) set(key, value []byte, addToCache bool) (bool, error) {
+	// returns bool: true if it was placed in the cache, false if it was placed into the db instead, error
+	k := makeKey(key)
+	v := append([]byte(nil), value...)
+
+	c.MutexLock.Lock()
+
+	if e, ok := c.data[k]; ok {
+		// if the data is already in the cache, update it there
+		c.stats.CacheHit()
+		c.policy.Touch(k)
+		e.last_updated = time.Now()
+		e.size = len(v)
+		e.value = v
+		c.MutexLock.Unlock()
+		return true, nil
+	}
+
+	c.stats.CacheMiss()
+	if !addToCache {
+		c.MutexLock.Unlock()
+		// otherwise write to pebble
+		if err := c.db.Set(key, value, pebble.Sync); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	if len(c.data) >= c.capacity {
+		// full: ask the replacement policy for a victim.
+		victimKey, victimValue, ok := c.makeRoom()
+		if !ok {
+			c.MutexLock.Unlock()
+			if err := c.db.Set(key, value, pebble.Sync); err != nil {
+				return false, err
+			}
+			return false, nil
+		}
+		if victimKey != "" {
+			// Enqueue without the lock held, same as evict(): enqueue
+			// blocks when the target worker's queue is full, and that
+			// worker can only drain it by acquiring this same lock to
+			// clearPending. Holding the lock across enqueue would let the
+			// two deadlock each other.
+			c.MutexLock.Unlock()
+			c.writeback.enqueue(c, victimKey, victimValue)
+			c.MutexLock.Lock()
+		}
+	}
+
+	c.policy.Insert(k)
+	en := &CacheEntry{
+		value:          v,
+		size:           len(v),
+		first_inserted: time.Now(),
+		last_updated:   time.Now(),
+	}
+	c.data[k] = en
+	c.stats.CacheAdd()
+	c.MutexLock.Unlock()
+	return true, nil
+}
+
+// makeRoom asks the replacement policy for a victim and removes it from the
+// resident map, returning its key/value so the caller can hand it to the
+// write-back pool without this shard's lock held. Called with c.MutexLock
+// already held. It returns ok=false if the policy has nothing left to
+// evict (e.g. everything is pinned as non-resident test entries), in which
+// case the caller must fall back to writing straight through to pebble.
+// key is "" when the policy's victim was already non-resident: a slot was
+// freed but there's nothing to write back.
+func (c *cacheShard) makeRoom() (key string, value []byte, ok bool) {
+	victim, ok := c.policy.Victim()
+	if !ok {
+		return "", nil, false
+	}
+	e, ok := c.data[victim]
+	if !ok {
+		// The policy tracked a key we no longer hold (e.g. it was already
+		// non-resident); nothing to flush, but the slot is free.
+		return "", nil, true
+	}
+	delete(c.data, victim)
+	c.pending[victim] = e.value
+	c.stats.CacheEvict()
+	return victim, e.value, true
+}
+
+func (c *cacheShard) evict(key []byte) (bool, error) {
+	// The key parameter gets evicted from the cache, and queued for an
+	// async write-back worker to flush into pebble.
+
+	// returns bool of if successfully evicted, error
+	k := makeKey(key)
+
+	c.MutexLock.Lock()
+
+	e, ok := c.data[k]
+	if !ok {
+		// this was never in the cache
+		c.MutexLock.Unlock()
+		return false, nil
+	}
+
+	// remove from the resident map, but keep the value reachable via
+	// pending until the write-back worker confirms it landed in pebble.
+	delete(c.data, k)
+	c.policy.Remove(k)
+	copied_val := append([]byte(nil), e.value...)
+	c.pending[k] = copied_val
+	c.MutexLock.Unlock()
+
+	// enqueue the write-back; this blocks if the queue is full, applying
+	// back-pressure to the caller instead of blocking on the fsync itself.
+	c.writeback.enqueue(c, k, copied_val)
+
+	c.stats.CacheEvict()
+
+	return true, nil
+}
+
+func (c *cacheShard) remainingCapacity() int {
+	c.MutexLock.RLock()
+	defer c.MutexLock.RUnlock()
+	return c.capacity - len(c.data)
+}
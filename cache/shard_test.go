@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// TestSetUnderEvictionPressureDoesNotDeadlock is a regression test for
+// makeRoom enqueueing a write-back while still holding the shard lock: with
+// a single writer and an unbuffered queue, the worker can only free a queue
+// slot by acquiring that same lock to clearPending, so holding it across
+// enqueue lets set() and the worker wedge against each other. Many
+// goroutines hammering a single, tiny shard reliably hits that window if
+// the lock is ever held across enqueue.
+func TestSetUnderEvictionPressureDoesNotDeadlock(t *testing.T) {
+	db, err := pebble.Open("", &pebble.Options{FS: vfs.NewMem()})
+	if err != nil {
+		t.Fatalf("pebble.Open: %v", err)
+	}
+	defer db.Close()
+
+	c := CreateCacheSharded(db, 1, 1, WithWriteBack(1, 0, nil))
+
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for g := 0; g < 32; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					k := []byte(fmt.Sprintf("k-%d-%d", g, i))
+					if _, err := c.Set(k, []byte("v"), true); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Set() under sustained eviction pressure with a single writer/unbuffered queue deadlocked")
+	}
+}
@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// writeTask is one pending write-back: key/value destined for pebble, plus
+// the shard that should have its pending-flush bookkeeping cleared once the
+// write lands.
+type writeTask struct {
+	key   string
+	value []byte
+	shard *cacheShard
+}
+
+// writeBackPool is a bounded pool of workers that drain writeTasks into
+// pebble asynchronously, modeled after sharedcache's write-worker pattern.
+// Evict (and Set's overflow path) enqueue onto tasks and return immediately;
+// a full queue applies back-pressure by blocking the enqueuing call.
+type writeBackPool struct {
+	db         *pebble.DB
+	durability *pebble.WriteOptions
+	secondary  *SecondaryCache // when set, evictions land here instead of pebble directly
+
+	// tasks holds one queue per worker. enqueue routes a key to the same
+	// queue every time (hashed, like shard selection), so two write-backs
+	// for the same key are always handled by the same worker and can never
+	// land in pebble out of enqueue order.
+	tasks []chan writeTask
+	wg    sync.WaitGroup
+
+	latency *histogram // evict-to-pebble flush latency
+
+	errMu   sync.Mutex
+	lastErr error // most recent write-back failure not yet reported by Flush
+}
+
+func newWriteBackPool(db *pebble.DB, numWriters, queueDepth int, durability *pebble.WriteOptions) *writeBackPool {
+	if numWriters < 1 {
+		numWriters = 1
+	}
+	if queueDepth < 0 {
+		queueDepth = 0
+	}
+	if durability == nil {
+		durability = pebble.Sync
+	}
+
+	p := &writeBackPool{
+		db:         db,
+		durability: durability,
+		tasks:      make([]chan writeTask, numWriters),
+		latency:    newHistogram(),
+	}
+	for i := range p.tasks {
+		p.tasks[i] = make(chan writeTask, queueDepth)
+	}
+	for i := range p.tasks {
+		go p.worker(p.tasks[i])
+	}
+	return p
+}
+
+func (p *writeBackPool) worker(ch chan writeTask) {
+	for task := range ch {
+		start := time.Now()
+		var err error
+		if p.secondary != nil {
+			err = p.secondary.Put([]byte(task.key), task.value)
+		} else {
+			err = p.db.Set([]byte(task.key), task.value, p.durability)
+		}
+		p.latency.observe(time.Since(start))
+		if err != nil {
+			// The write never landed: leave it in the shard's pending map
+			// (so Get keeps serving it) instead of clearing it, and make
+			// the failure observable instead of only logging it.
+			log.Println(err)
+			task.shard.stats.CacheWriteBackFailure()
+			p.errMu.Lock()
+			p.lastErr = err
+			p.errMu.Unlock()
+		} else {
+			task.shard.clearPending(task.key)
+		}
+		p.wg.Done()
+	}
+}
+
+// enqueue hands a write-back task to the pool. It blocks when that key's
+// queue is full, which is the intended back-pressure on the caller (e.g.
+// Evict).
+func (p *writeBackPool) enqueue(shard *cacheShard, key string, value []byte) {
+	p.wg.Add(1)
+	ch := p.tasks[fnv1a([]byte(key))%uint64(len(p.tasks))]
+	ch <- writeTask{key: key, value: value, shard: shard}
+}
+
+// QueueDepth reports how many write-back tasks are currently buffered,
+// waiting for a worker, summed across every worker's queue.
+func (p *writeBackPool) QueueDepth() int {
+	depth := 0
+	for _, ch := range p.tasks {
+		depth += len(ch)
+	}
+	return depth
+}
+
+// AverageWriteLatency reports the mean pebble write latency observed by the
+// write-back workers so far.
+func (p *writeBackPool) AverageWriteLatency() time.Duration {
+	return p.latency.mean()
+}
+
+// Flush blocks until every write-back task enqueued so far has been
+// attempted, or ctx is done, whichever comes first. If any attempt failed,
+// Flush returns the most recent failure (and clears it, so a later,
+// successful Flush reports nil again) instead of silently returning nil --
+// a failed write-back is not "flushed", it's still sitting in its shard's
+// pending map.
+func (p *writeBackPool) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.errMu.Lock()
+		err := p.lastErr
+		p.lastErr = nil
+		p.errMu.Unlock()
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush blocks until a write-back of every Evict (and overflow Set) issued so
+// far has been attempted, or ctx is done. It returns the most recent
+// write-back failure, if any.
+func (c *Cache) Flush(ctx context.Context) error {
+	return c.writeback.Flush(ctx)
+}
+
+// QueueDepth reports how many write-back tasks are buffered across the
+// cache's shared worker pool.
+func (c *Cache) QueueDepth() int {
+	return c.writeback.QueueDepth()
+}